@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// docTmpl renders struct/field Doc the way a real .tmpl would: "// ..." for
+// Go, "/// <summary>...</summary>" for C#, dispatching on .Lang.
+const docTmpl = `{{$lang := .Lang}}{{range .Doc}}{{if eq $lang "go"}}// {{.}}
+{{else}}/// <summary>{{.}}</summary>
+{{end}}{{end}}type {{.Name}} {
+{{range .Fields}}{{range .Doc}}{{if eq $lang "go"}}  // {{.}}
+{{else}}  /// <summary>{{.}}</summary>
+{{end}}{{end}}  {{.Name}}
+{{end}}}
+`
+
+// TestDocCommentsRoundTrip parses a schema with both a leading struct
+// comment and a trailing field comment, then renders it for two different
+// languages and checks the original comment text survives verbatim.
+func TestDocCommentsRoundTrip(t *testing.T) {
+	f, err := os.Open("testdata/doc_schema.def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	infos, err := parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("parse() returned %d structs, want 1", len(infos))
+	}
+	tag := infos[0]
+
+	wantStructDoc := "Tag represents a label attached to a person."
+	if got := tag.Doc; len(got) != 1 || got[0] != wantStructDoc {
+		t.Fatalf("Tag.Doc = %v, want [%q]", got, wantStructDoc)
+	}
+
+	if len(tag.Fields) != 1 {
+		t.Fatalf("Tag has %d fields, want 1", len(tag.Fields))
+	}
+	wantFieldDoc := "display name"
+	if got := tag.Fields[0].Doc; len(got) != 1 || got[0] != wantFieldDoc {
+		t.Fatalf("Tag.Fields[0].Doc = %v, want [%q]", got, wantFieldDoc)
+	}
+
+	tmpl := template.Must(template.New("doc").Parse(docTmpl))
+
+	for _, tc := range []struct {
+		lang       string
+		structWant string
+		fieldWant  string
+	}{
+		{"go", "// " + wantStructDoc, "// " + wantFieldDoc},
+		{"cs", "/// <summary>" + wantStructDoc + "</summary>", "/// <summary>" + wantFieldDoc + "</summary>"},
+	} {
+		info := tag
+		info.Lang = tc.lang
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, info); err != nil {
+			t.Fatalf("%s: %v", tc.lang, err)
+		}
+		out := buf.String()
+
+		if !strings.Contains(out, tc.structWant) {
+			t.Fatalf("%s output missing struct doc %q:\n%s", tc.lang, tc.structWant, out)
+		}
+		if !strings.Contains(out, tc.fieldWant) {
+			t.Fatalf("%s output missing field doc %q:\n%s", tc.lang, tc.fieldWant, out)
+		}
+	}
+}
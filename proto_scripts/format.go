@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// formatSource runs the language-appropriate formatter over src and returns
+// the formatted output. Languages with no registered formatter (and external
+// formatters that aren't installed) pass src through unchanged.
+func formatSource(lang string, src []byte) ([]byte, error) {
+	switch lang {
+	case "go":
+		out, err := format.Source(src)
+		if err != nil {
+			return src, fmt.Errorf("gofmt: %w", err)
+		}
+		return out, nil
+	case "cs":
+		return formatCs(src)
+	default:
+		return src, nil
+	}
+}
+
+// formatCs shells out to `dotnet format` when the .NET SDK is on PATH;
+// otherwise it passes src through unchanged so environments without it
+// still produce output.
+func formatCs(src []byte) ([]byte, error) {
+	dotnet, err := exec.LookPath("dotnet")
+	if err != nil {
+		return src, nil
+	}
+
+	dir, err := ioutil.TempDir("", "protogen-cs")
+	if err != nil {
+		return src, fmt.Errorf("dotnet format: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "generated.cs")
+	if err := ioutil.WriteFile(file, src, 0644); err != nil {
+		return src, fmt.Errorf("dotnet format: %w", err)
+	}
+
+	cmd := exec.Command(dotnet, "format", "--include", file)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return src, fmt.Errorf("dotnet format: %w: %s", err, out)
+	}
+
+	formatted, err := ioutil.ReadFile(file)
+	if err != nil {
+		return src, fmt.Errorf("dotnet format: %w", err)
+	}
+	return formatted, nil
+}
+
+// reportFormatError prints a formatter failure together with the offending
+// source, line-numbered, so a template bug can be tracked down without
+// aborting the whole run.
+func reportFormatError(lang string, src []byte, err error) {
+	log.Printf("%s formatter error: %v", lang, err)
+	for i, line := range strings.Split(string(src), "\n") {
+		log.Printf("%4d | %s", i+1, line)
+	}
+}
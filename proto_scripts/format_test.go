@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestFormatSourceGoCanonicalizes(t *testing.T) {
+	messy := []byte("package  main\nfunc   Foo( )   {\nreturn\n}\n")
+	out, err := formatSource("go", messy)
+	if err != nil {
+		t.Fatalf("formatSource: %v", err)
+	}
+	if want := "package main\n\nfunc Foo() {\n\treturn\n}\n"; string(out) != want {
+		t.Fatalf("formatSource output = %q, want %q", out, want)
+	}
+}
+
+func TestFormatSourceGoReportsErrorWithoutAborting(t *testing.T) {
+	broken := []byte("package main\nfunc Foo( {\n")
+	out, err := formatSource("go", broken)
+	if err == nil {
+		t.Fatal("expected a format error for invalid Go source")
+	}
+	if string(out) != string(broken) {
+		t.Fatal("formatSource should return the original source unchanged on error")
+	}
+}
+
+func TestFormatSourcePassthroughForUnknownLang(t *testing.T) {
+	src := []byte("whatever")
+	out, err := formatSource("rust", src)
+	if err != nil {
+		t.Fatalf("formatSource: %v", err)
+	}
+	if string(out) != string(src) {
+		t.Fatal("formatSource should pass unknown languages through unchanged")
+	}
+}
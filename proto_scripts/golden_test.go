@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"text/template"
+)
+
+// goldenTmpl renders just the shape the importers promise to agree on
+// (struct/field names, types, array-ness) so the test isn't coupled to any
+// particular target language's func_map bindings.
+const goldenTmpl = `{{range .}}struct {{.Name}} {
+{{range .Fields}}  {{.Name}} {{if .Array}}[]{{end}}{{.Typ}}
+{{end}}}
+{{end}}`
+
+func renderGolden(t *testing.T, infos []struct_info) string {
+	t.Helper()
+	tmpl := template.Must(template.New("golden").Parse(goldenTmpl))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, infos); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// TestFrontendsAgreeWithDSL checks that the proto3 and JSON Schema
+// front-ends lower testdata/schema.{proto,jsonschema} to exactly the same
+// generator output as the hand-written testdata/schema.def.
+func TestFrontendsAgreeWithDSL(t *testing.T) {
+	dsl, err := os.Open("testdata/schema.def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dsl.Close()
+	dslInfos, err := parse(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := renderGolden(t, dslInfos)
+
+	golden, err := ioutil.ReadFile("testdata/golden.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != string(golden) {
+		t.Fatalf("DSL rendering drifted from testdata/golden.txt:\ngot:\n%s\nwant:\n%s", want, golden)
+	}
+
+	protoFile, err := os.Open("testdata/schema.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer protoFile.Close()
+	protoInfos, err := parseProto(protoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := renderGolden(t, protoInfos); got != want {
+		t.Fatalf("proto front-end output differs from the DSL golden:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	jsonFile, err := os.Open("testdata/schema.jsonschema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jsonFile.Close()
+	jsonInfos, err := parseJSONSchema(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := renderGolden(t, jsonInfos); got != want {
+		t.Fatalf("jsonschema front-end output differs from the DSL golden:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// jsonTypes maps JSON Schema primitive types onto the datatype vocabulary
+// the DSL and func_map.json already use.
+var jsonTypes = map[string]string{
+	"string":  "string",
+	"integer": "integer",
+	"number":  "float",
+	"boolean": "boolean",
+}
+
+type jsonSchemaProp struct {
+	Type                 string          `json:"type"`
+	Ref                  string          `json:"$ref"`
+	Items                *jsonSchemaProp `json:"items"`
+	AdditionalProperties interface{}     `json:"additionalProperties"`
+}
+
+type jsonSchemaDef struct {
+	Type                 string          `json:"type"`
+	Properties           json.RawMessage `json:"properties"`
+	AdditionalProperties interface{}     `json:"additionalProperties"`
+	OneOf                []interface{}   `json:"oneOf"`
+	AnyOf                []interface{}   `json:"anyOf"`
+}
+
+type jsonSchemaDoc struct {
+	Definitions json.RawMessage `json:"definitions"`
+}
+
+// parseJSONSchema lowers a JSON Schema document's "definitions" into the
+// same []struct_info the DSL parser produces. Each definition must be a
+// plain `type: object`; oneOf/anyOf/additionalProperties have no DSL
+// equivalent and are a hard error. Definitions and properties keep their
+// source order (JSON object key order isn't preserved by map[string]T), so
+// generator output lines up with the equivalent hand-written DSL file.
+func parseJSONSchema(r io.Reader) ([]struct_info, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc jsonSchemaDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Definitions) == 0 {
+		return nil, fmt.Errorf("jsonschema: no \"definitions\" found")
+	}
+
+	names, defs, err := orderedObject(doc.Definitions)
+	if err != nil {
+		return nil, fmt.Errorf("jsonschema: definitions: %w", err)
+	}
+
+	infos := make([]struct_info, 0, len(names))
+	for _, name := range names {
+		var def jsonSchemaDef
+		if err := json.Unmarshal(defs[name], &def); err != nil {
+			return nil, fmt.Errorf("jsonschema: %s: %w", name, err)
+		}
+		if def.Type != "object" {
+			return nil, fmt.Errorf("jsonschema: %s: only type \"object\" is supported, got %q", name, def.Type)
+		}
+		if def.AdditionalProperties != nil {
+			return nil, fmt.Errorf("jsonschema: %s: additionalProperties is not supported", name)
+		}
+		if len(def.OneOf) > 0 || len(def.AnyOf) > 0 {
+			return nil, fmt.Errorf("jsonschema: %s: oneOf/anyOf are not supported", name)
+		}
+
+		info := struct_info{Name: name}
+
+		propNames, props, err := orderedObject(def.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("jsonschema: %s: properties: %w", name, err)
+		}
+		for _, pname := range propNames {
+			var prop jsonSchemaProp
+			if err := json.Unmarshal(props[pname], &prop); err != nil {
+				return nil, fmt.Errorf("jsonschema: %s.%s: %w", name, pname, err)
+			}
+			field, err := lowerJSONSchemaProp(name, pname, prop)
+			if err != nil {
+				return nil, err
+			}
+			info.Fields = append(info.Fields, field)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// orderedObject decodes a JSON object while preserving the order its keys
+// appeared in the source, which encoding/json's map decoding does not.
+func orderedObject(raw json.RawMessage) (keys []string, values map[string]json.RawMessage, err error) {
+	values = map[string]json.RawMessage{}
+	if len(raw) == 0 {
+		return nil, values, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, nil, fmt.Errorf("expected a JSON object")
+	}
+
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := keyTok.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected a string key")
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+
+		keys = append(keys, key)
+		values[key] = value
+	}
+	return keys, values, nil
+}
+
+func lowerJSONSchemaProp(structName, fieldName string, prop jsonSchemaProp) (field_info, error) {
+	if prop.AdditionalProperties != nil {
+		return field_info{}, fmt.Errorf("jsonschema: %s.%s: additionalProperties is not supported", structName, fieldName)
+	}
+
+	switch {
+	case prop.Ref != "":
+		return field_info{Name: fieldName, Typ: refName(prop.Ref)}, nil
+
+	case prop.Type == "array":
+		if prop.Items == nil {
+			return field_info{}, fmt.Errorf("jsonschema: %s.%s: array is missing \"items\"", structName, fieldName)
+		}
+		switch {
+		case prop.Items.Ref != "":
+			return field_info{Name: fieldName, Typ: refName(prop.Items.Ref), Array: true}, nil
+		case jsonTypes[prop.Items.Type] != "":
+			return field_info{Name: fieldName, Typ: jsonTypes[prop.Items.Type], Array: true}, nil
+		default:
+			return field_info{}, fmt.Errorf("jsonschema: %s.%s: unsupported array item type %q", structName, fieldName, prop.Items.Type)
+		}
+
+	case jsonTypes[prop.Type] != "":
+		return field_info{Name: fieldName, Typ: jsonTypes[prop.Type]}, nil
+
+	default:
+		return field_info{}, fmt.Errorf("jsonschema: %s.%s: unsupported type %q", structName, fieldName, prop.Type)
+	}
+}
+
+// refName extracts the trailing identifier of a JSON Schema $ref, e.g.
+// "#/definitions/Tag" -> "Tag".
+func refName(ref string) string {
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		return ref[i+1:]
+	}
+	return ref
+}
@@ -3,11 +3,15 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"regexp"
+	"path/filepath"
+	"sort"
+	"strings"
 	"text/template"
 	"unicode"
 )
@@ -18,6 +22,7 @@ const (
 	STRUCT_END
 	DATA_TYPE
 	ARRAY_TYPE
+	COMMENT
 	TK_EOF
 )
 
@@ -31,7 +36,16 @@ var (
 		"float":   true,
 	}
 
-	funcs map[string]lang_type
+	// funcs maps schema type name -> language id -> binding info, e.g.
+	// funcs["integer"]["go"] describes how an "integer" field reads/writes in Go.
+	funcs map[string]map[string]func_info
+
+	// selectedLangSpec, noFmt and inFormat mirror the -lang/-nofmt/-in-format
+	// flags. Generate reads them so both the one-shot and watch commands
+	// share one set of options without threading them through every call.
+	selectedLangSpec string
+	noFmt            bool
+	inFormat         string
 )
 
 var (
@@ -44,19 +58,18 @@ type func_info struct {
 	W string `json:"w"` // write
 }
 
-type lang_type struct {
-	Go func_info `json:"go"` // golang
-	Cs func_info `json:"cs"` // c#
-}
 type (
 	field_info struct {
 		Name  string
 		Typ   string
 		Array bool
+		Doc   []string // comment lines attached to this field, in source order
 	}
 	struct_info struct {
 		Name   string
 		Fields []field_info
+		Lang   string   // language id currently being rendered, e.g. "go", "cs", "ts"
+		Doc    []string // comment lines attached to this struct, in source order
 	}
 )
 
@@ -64,10 +77,21 @@ type token struct {
 	typ     int
 	literal string
 	r       rune
+	line    int
 }
 
+// parseError is recovered by parse so a malformed schema aborts just the
+// current generation pass instead of killing a long-running watch.
+type parseError struct{ msg string }
+
+func (e *parseError) Error() string { return e.msg }
+
 func syntax_error(p *Parser) {
-	log.Fatal("syntax error @line:", p.lexer.lineno)
+	panic(&parseError{fmt.Sprintf("syntax error @line:%d", p.lexer.lineno)})
+}
+
+func lex_error(lex *Lexer) {
+	panic(&parseError{fmt.Sprintf("lex error @line:%d", lex.lineno)})
 }
 
 type Lexer struct {
@@ -81,9 +105,6 @@ func (lex *Lexer) init(r io.Reader) {
 		log.Println(err)
 	}
 
-	// 清除注释
-	re := regexp.MustCompile("(?m:^#(.*)$)")
-	bts = re.ReplaceAllLiteral(bts, nil)
 	lex.reader = bytes.NewBuffer(bts)
 	lex.lineno = 1
 }
@@ -106,6 +127,7 @@ func (lex *Lexer) next() (t *token) {
 		}
 		break
 	}
+	line := lex.lineno
 
 	if r == '=' {
 		for k := 0; k < 2; k++ { // check "==="
@@ -115,10 +137,23 @@ func (lex *Lexer) next() (t *token) {
 			}
 			if r != '=' {
 				lex.reader.UnreadRune()
-				return &token{typ: STRUCT_BEGIN}
+				return &token{typ: STRUCT_BEGIN, line: line}
+			}
+		}
+		return &token{typ: STRUCT_END, line: line}
+	} else if r == '#' {
+		var runes []rune
+		for {
+			r, _, err = lex.reader.ReadRune()
+			if err == io.EOF {
+				break
+			} else if r == '\n' {
+				lex.reader.UnreadRune()
+				break
 			}
+			runes = append(runes, r)
 		}
-		return &token{typ: STRUCT_END}
+		return &token{typ: COMMENT, literal: strings.TrimSpace(string(runes)), line: line}
 	} else if unicode.IsLetter(r) {
 		var runes []rune
 		for {
@@ -134,7 +169,7 @@ func (lex *Lexer) next() (t *token) {
 			}
 		}
 
-		t := &token{}
+		t := &token{line: line}
 		t.literal = string(runes)
 		if datatypes[t.literal] {
 			t.typ = DATA_TYPE
@@ -146,7 +181,7 @@ func (lex *Lexer) next() (t *token) {
 
 		return t
 	} else {
-		log.Fatal("lex error @line:", lex.lineno)
+		lex_error(lex)
 	}
 	return nil
 }
@@ -170,16 +205,59 @@ func (lex *Lexer) eof() bool {
 
 //////////////////////////////////////////////////////////////
 type Parser struct {
-	lexer *Lexer
-	info  []struct_info
+	lexer      *Lexer
+	info       []struct_info
+	peeked     *token
+	pendingDoc []string // comment lines seen since the last declaration, in source order
 }
 
 func (p *Parser) init(lex *Lexer) {
 	p.lexer = lex
 }
 
+// advance returns the next raw token, preferring one already peeked.
+func (p *Parser) advance() *token {
+	if p.peeked != nil {
+		t := p.peeked
+		p.peeked = nil
+		return t
+	}
+	return p.lexer.next()
+}
+
+// peek returns the next raw token without consuming it.
+func (p *Parser) peek() *token {
+	if p.peeked == nil {
+		p.peeked = p.lexer.next()
+	}
+	return p.peeked
+}
+
+// next returns the next non-comment token, stashing any COMMENT literals
+// it skips over into pendingDoc so they can be attached to whatever
+// declaration follows.
+func (p *Parser) next() *token {
+	for {
+		t := p.advance()
+		if t.typ != COMMENT {
+			return t
+		}
+		p.pendingDoc = append(p.pendingDoc, t.literal)
+	}
+}
+
+// takeDoc drains and returns the comment lines accumulated so far.
+func (p *Parser) takeDoc() []string {
+	if len(p.pendingDoc) == 0 {
+		return nil
+	}
+	doc := p.pendingDoc
+	p.pendingDoc = nil
+	return doc
+}
+
 func (p *Parser) match(typ int) *token {
-	t := p.lexer.next()
+	t := p.next()
 	if t.typ != typ {
 		syntax_error(p)
 	}
@@ -194,6 +272,7 @@ func (p *Parser) expr() bool {
 
 	t := p.match(SYMBOL)
 	info.Name = t.literal
+	info.Doc = p.takeDoc()
 
 	p.match(STRUCT_BEGIN)
 	p.fields(&info)
@@ -203,8 +282,9 @@ func (p *Parser) expr() bool {
 
 func (p *Parser) fields(info *struct_info) {
 	for {
-		t := p.lexer.next()
+		t := p.next()
 		if t.typ == STRUCT_END {
+			p.takeDoc() // drop a trailing comment that has no following field to attach to
 			return
 		}
 		if t.typ != SYMBOL {
@@ -212,7 +292,7 @@ func (p *Parser) fields(info *struct_info) {
 		}
 
 		field := field_info{Name: t.literal}
-		t = p.lexer.next()
+		t = p.next()
 		if t.typ == ARRAY_TYPE {
 			field.Array = true
 			t = p.match(SYMBOL)
@@ -223,101 +303,245 @@ func (p *Parser) fields(info *struct_info) {
 			syntax_error(p)
 		}
 
+		field.Doc = p.takeDoc()
+		if p.peek().typ == COMMENT && p.peek().line == t.line {
+			field.Doc = append(field.Doc, p.advance().literal)
+		}
+
 		info.Fields = append(info.Fields, field)
 	}
 }
 
-func main() {
+// parseSchema dispatches to the front-end selected by -in-format. Every
+// front-end produces the same []struct_info, so the template layer doesn't
+// need to know which one ran.
+func parseSchema(r io.Reader) ([]struct_info, error) {
+	switch inFormat {
+	case "", "dsl":
+		return parse(r)
+	case "proto":
+		return parseProto(r)
+	case "jsonschema":
+		return parseJSONSchema(r)
+	default:
+		return nil, fmt.Errorf("unknown -in-format %q (want dsl, proto, or jsonschema)", inFormat)
+	}
+}
 
-	if len(os.Args) != 2 {
-		return
+// parse reads schema DSL from r and returns the parsed struct_infos. A
+// malformed schema yields an error instead of aborting the process, so
+// callers like the watch loop can report it and keep running.
+func parse(r io.Reader) (infos []struct_info, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			pe, ok := rec.(*parseError)
+			if !ok {
+				panic(rec)
+			}
+			err = pe
+		}
+	}()
+
+	lexer := Lexer{}
+	lexer.init(r)
+	p := Parser{}
+	p.init(&lexer)
+	for p.expr() {
 	}
+	return p.info, nil
+}
 
-	f, err := os.Open("func_map.json")
+// loadFuncMap reads the schema-type -> language -> binding table from path.
+// It returns an error rather than fataling so a momentarily-invalid
+// func_map.json (e.g. mid-edit) doesn't kill a long-running watch.
+func loadFuncMap(path string) (map[string]map[string]func_info, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	defer f.Close()
+
 	dec := json.NewDecoder(f)
 
 	// read open bracket
-	_, err = dec.Token()
-	if err != nil {
-		log.Fatal(err)
+	if _, err := dec.Token(); err != nil {
+		return nil, err
 	}
 
+	m := map[string]map[string]func_info{}
 	for dec.More() {
 		// decode an array value (Message)
-		err := dec.Decode(&funcs)
-		if err != nil {
-			log.Fatal(err)
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
 		}
 	}
 
 	// read closing bracket
-	_, err = dec.Token()
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// langs returns every language id present in the func map, sorted for
+// deterministic output.
+func langs(funcs map[string]map[string]func_info) []string {
+	seen := map[string]bool{}
+	for _, byLang := range funcs {
+		for lang := range byLang {
+			seen[lang] = true
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for lang := range seen {
+		out = append(out, lang)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// selectLangs parses the comma-separated -lang flag value against the
+// languages known to funcs. An empty spec selects every known language.
+func selectLangs(spec string, funcs map[string]map[string]func_info) []string {
+	known := langs(funcs)
+	if spec == "" {
+		return known
+	}
+
+	knownSet := map[string]bool{}
+	for _, l := range known {
+		knownSet[l] = true
+	}
+
+	var out []string
+	for _, l := range strings.Split(spec, ",") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		if !knownSet[l] {
+			log.Fatalf("unknown language %q (known: %s)", l, strings.Join(known, ", "))
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// exportName turns a language id ("go", "cs", "ts") into the Type/Read/Write
+// template func prefix ("Go", "Cs", "Ts").
+func exportName(lang string) string {
+	if lang == "" {
+		return ""
+	}
+	return strings.ToUpper(lang[:1]) + lang[1:]
+}
+
+// buildFuncMap registers {Lang}Type/{Lang}Read/{Lang}Write template funcs for
+// every language id found in funcs.
+func buildFuncMap(funcs map[string]map[string]func_info) template.FuncMap {
+	funcMap := template.FuncMap{}
+	for _, lang := range langs(funcs) {
+		lang := lang
+		name := exportName(lang)
+		funcMap[name+"Type"] = func(t string) string {
+			return funcs[t][lang].T
+		}
+		funcMap[name+"Read"] = func(t string) string {
+			return funcs[t][lang].R
+		}
+		funcMap[name+"Write"] = func(t string) string {
+			return funcs[t][lang].W
+		}
+	}
+	return funcMap
+}
+
+// Generate runs the full parse+template+format pipeline once: it reads the
+// schema from schemaPath ("-" for stdin), renders tmplPath for every
+// selected language (via selectedLangSpec/noFmt), and writes the result to
+// out. It shares this path with the one-shot command and the watch loop.
+func Generate(schemaPath, tmplPath, funcMapPath string, out io.Writer) error {
+	loaded, err := loadFuncMap(funcMapPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	funcs = loaded
+	selected := selectLangs(selectedLangSpec, funcs)
 
-	lexer := Lexer{}
-	lexer.init(os.Stdin)
-	p := Parser{}
-	p.init(&lexer)
-	for p.expr() {
+	var schema io.Reader = os.Stdin
+	if schemaPath != "-" {
+		f, err := os.Open(schemaPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		schema = f
 	}
 
-	log.Println(p.info)
+	infos, err := parseSchema(schema)
+	if err != nil {
+		return err
+	}
 
-	funcMap := template.FuncMap{
-		"goType": func(t string) string {
-			if v, ok := funcs[t]; ok {
-				return v.Go.T
-			} else {
-				return ""
-			}
-		},
-		"goRead": func(t string) string {
-			if v, ok := funcs[t]; ok {
-				return v.Go.R
-			} else {
-				return ""
-			}
-		},
-		"goWrite": func(t string) string {
-			if v, ok := funcs[t]; ok {
-				return v.Go.W
-			} else {
-				return ""
-			}
-		},
-		"csType": func(t string) string {
-			if v, ok := funcs[t]; ok {
-				return v.Cs.T
-			} else {
-				return ""
-			}
-		},
-		"csRead": func(t string) string {
-			if v, ok := funcs[t]; ok {
-				return v.Cs.R
-			} else {
-				return ""
-			}
-		},
-		"csWrite": func(t string) string {
-			if v, ok := funcs[t]; ok {
-				return v.Cs.W
+	tmpl, err := template.New(filepath.Base(tmplPath)).Funcs(buildFuncMap(funcs)).ParseFiles(tmplPath)
+	if err != nil {
+		return err
+	}
+
+	for _, lang := range selected {
+		for i := range infos {
+			infos[i].Lang = lang
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, infos); err != nil {
+			return err
+		}
+
+		rendered := buf.Bytes()
+		if !noFmt {
+			formatted, err := formatSource(lang, rendered)
+			if err != nil {
+				reportFormatError(lang, rendered, err)
 			} else {
-				return ""
+				rendered = formatted
 			}
-		},
+		}
+
+		if _, err := out.Write(rendered); err != nil {
+			return err
+		}
 	}
-	tmpl, err := template.New("proto.tmpl").Funcs(funcMap).ParseFiles(os.Args[1])
-	if err != nil {
-		log.Fatal(err)
+	return nil
+}
+
+func generateMain(args []string) {
+	fs := flag.NewFlagSet("codegen", flag.ExitOnError)
+	langFlag := fs.String("lang", "", "comma-separated language ids to generate (default: all languages in func_map.json)")
+	noFmtFlag := fs.Bool("nofmt", false, "skip post-generation formatting")
+	inFormatFlag := fs.String("in-format", "dsl", "schema front-end: dsl, proto, or jsonschema")
+	fs.Parse(args)
+
+	rest := fs.Args()
+	if len(rest) != 1 {
+		return
 	}
-	err = tmpl.Execute(os.Stdout, p.info)
-	if err != nil {
+
+	selectedLangSpec = *langFlag
+	noFmt = *noFmtFlag
+	inFormat = *inFormatFlag
+
+	if err := Generate("-", rest[0], "func_map.json", os.Stdout); err != nil {
 		log.Fatal(err)
 	}
 }
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "watch" {
+		watchMain(args[1:])
+		return
+	}
+	generateMain(args)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// protoTypes maps proto3 scalar type names onto the datatype vocabulary the
+// DSL and func_map.json already use, so a single template can render fields
+// from either front-end.
+var protoTypes = map[string]string{
+	"int32": "integer", "int64": "integer", "uint32": "integer", "uint64": "integer",
+	"sint32": "integer", "sint64": "integer", "fixed32": "integer", "fixed64": "integer",
+	"sfixed32": "integer", "sfixed64": "integer",
+	"float": "float", "double": "float",
+	"bool":   "boolean",
+	"string": "string",
+	"bytes":  "bytes",
+}
+
+var (
+	protoMessageRe = regexp.MustCompile(`^message\s+(\w+)\s*\{$`)
+	protoEnumRe    = regexp.MustCompile(`^enum\s+(\w+)\s*\{$`)
+	protoFieldRe   = regexp.MustCompile(`^(repeated\s+)?([\w.]+)\s+(\w+)\s*=\s*\d+\s*;$`)
+	protoOneofRe   = regexp.MustCompile(`^oneof\s+\w+\s*\{$`)
+)
+
+// parseProto lowers a proto3 source into the same []struct_info the DSL
+// parser produces. Enums are recorded by name (so messages can reference
+// them as a field type) but carry no fields of their own. Constructs that
+// have no DSL equivalent - oneof, map<> - are a hard error.
+func parseProto(r io.Reader) ([]struct_info, error) {
+	scanner := bufio.NewScanner(r)
+	var infos []struct_info
+	var cur *struct_info
+	inEnum := false
+	lineno := 0
+
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || isProtoPreamble(line) {
+			continue
+		}
+
+		if inEnum {
+			if line == "}" {
+				inEnum = false
+			}
+			continue
+		}
+
+		if cur == nil {
+			switch {
+			case protoMessageRe.MatchString(line):
+				name := protoMessageRe.FindStringSubmatch(line)[1]
+				infos = append(infos, struct_info{Name: name})
+				cur = &infos[len(infos)-1]
+			case protoEnumRe.MatchString(line):
+				name := protoEnumRe.FindStringSubmatch(line)[1]
+				infos = append(infos, struct_info{Name: name})
+				inEnum = true
+			default:
+				return nil, fmt.Errorf("proto:%d: cannot lower %q", lineno, line)
+			}
+			continue
+		}
+
+		switch {
+		case line == "}":
+			cur = nil
+		case protoOneofRe.MatchString(line):
+			return nil, fmt.Errorf("proto:%d: oneof is not supported", lineno)
+		case strings.Contains(line, "map<"):
+			return nil, fmt.Errorf("proto:%d: map<> fields are not supported", lineno)
+		case protoFieldRe.MatchString(line):
+			m := protoFieldRe.FindStringSubmatch(line)
+			repeated, typ, name := m[1] != "", m[2], m[3]
+			if mapped, ok := protoTypes[typ]; ok {
+				typ = mapped
+			}
+			cur.Fields = append(cur.Fields, field_info{Name: name, Typ: typ, Array: repeated})
+		default:
+			return nil, fmt.Errorf("proto:%d: cannot lower %q", lineno, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+func isProtoPreamble(line string) bool {
+	for _, prefix := range []string{"//", "syntax", "package", "import", "option"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
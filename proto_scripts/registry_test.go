@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestBuildFuncMapThreeLanguages(t *testing.T) {
+	funcs := map[string]map[string]func_info{
+		"integer": {
+			"go": {T: "int64", R: "ReadInt64", W: "WriteInt64"},
+			"cs": {T: "long", R: "ReadInt64", W: "WriteInt64"},
+			"ts": {T: "number", R: "readNumber", W: "writeNumber"},
+		},
+	}
+
+	if got, want := langs(funcs), []string{"cs", "go", "ts"}; !equalStrings(got, want) {
+		t.Fatalf("langs() = %v, want %v", got, want)
+	}
+
+	funcMap := buildFuncMap(funcs)
+	for _, name := range []string{"GoType", "GoRead", "GoWrite", "CsType", "CsRead", "CsWrite", "TsType", "TsRead", "TsWrite"} {
+		if _, ok := funcMap[name]; !ok {
+			t.Fatalf("buildFuncMap missing func %q", name)
+		}
+	}
+
+	tmpl := template.Must(template.New("t").Funcs(funcMap).Parse(
+		`{{GoType "integer"}}/{{CsType "integer"}}/{{TsType "integer"}}`))
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "int64/long/number"; got != want {
+		t.Fatalf("template output = %q, want %q", got, want)
+	}
+}
+
+func TestSelectLangs(t *testing.T) {
+	funcs := map[string]map[string]func_info{
+		"integer": {"go": {}, "cs": {}, "ts": {}},
+	}
+
+	if got := selectLangs("", funcs); len(got) != 3 {
+		t.Fatalf("selectLangs(\"\") = %v, want all 3 languages", got)
+	}
+
+	if got, want := selectLangs("ts,go", funcs), []string{"ts", "go"}; !equalStrings(got, want) {
+		t.Fatalf("selectLangs(\"ts,go\") = %v, want %v", got, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce absorbs the burst of write events an editor fires for a
+// single save so we don't re-run the pipeline several times per edit.
+const watchDebounce = 200 * time.Millisecond
+
+// watchMain implements `codegen watch schema.def proto.tmpl -o out.go`: it
+// runs Generate once, then again on every change to the schema, template, or
+// func map, until killed. Parse errors are logged and watching continues.
+func watchMain(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	outPath := fs.String("o", "", "output file (default: stdout)")
+	langFlag := fs.String("lang", "", "comma-separated language ids to generate (default: all languages in func_map.json)")
+	noFmtFlag := fs.Bool("nofmt", false, "skip post-generation formatting")
+	inFormatFlag := fs.String("in-format", "dsl", "schema front-end: dsl, proto, or jsonschema")
+
+	// flag.FlagSet stops scanning for flags at the first positional arg, so
+	// `watch schema.def proto.tmpl -o out.go` would otherwise leave -o/out.go
+	// in rest. Split flags (and their values) out from the positionals
+	// first so they can appear in any order, as the usage string promises.
+	flagArgs, rest := splitFlags(args, map[string]bool{"nofmt": true})
+	fs.Parse(flagArgs)
+
+	if len(rest) != 2 {
+		log.Fatal("usage: codegen watch <schema> <template> [-o out] [-lang ids] [-nofmt] [-in-format dsl|proto|jsonschema]")
+	}
+	schemaPath, tmplPath := rest[0], rest[1]
+	const funcMapPath = "func_map.json"
+
+	selectedLangSpec = *langFlag
+	noFmt = *noFmtFlag
+	inFormat = *inFormatFlag
+
+	run := func() {
+		out, closeOut, err := watchOutput(*outPath)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer closeOut()
+
+		if err := Generate(schemaPath, tmplPath, funcMapPath, out); err != nil {
+			log.Println(err)
+		}
+	}
+
+	run()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer watcher.Close()
+
+	for _, p := range []string{schemaPath, tmplPath, funcMapPath} {
+		if err := watcher.Add(p); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var timer *time.Timer
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(watchDebounce, run)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println(err)
+		}
+	}
+}
+
+// splitFlags separates -flag (and -flag=value) tokens, plus the value of
+// any non-boolean flag, out of args so they can be parsed regardless of
+// where they fall relative to the positional arguments. boolFlags lists the
+// flag names (without leading dashes) that take no value.
+func splitFlags(args []string, boolFlags map[string]bool) (flagArgs, positional []string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") {
+			positional = append(positional, a)
+			continue
+		}
+
+		flagArgs = append(flagArgs, a)
+		name := strings.TrimLeft(a, "-")
+		if strings.Contains(name, "=") || boolFlags[name] {
+			continue
+		}
+		if i+1 < len(args) {
+			i++
+			flagArgs = append(flagArgs, args[i])
+		}
+	}
+	return flagArgs, positional
+}
+
+// watchOutput opens path for writing, or stdout when path is empty. When the
+// error is nil, the returned close func is always safe to call; on error it
+// is nil.
+func watchOutput(path string) (io.Writer, func(), error) {
+	if path == "" {
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}